@@ -0,0 +1,564 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/convox/convox/pkg/cli/output"
+	"github.com/convox/convox/pkg/cli/resource"
+	"github.com/convox/convox/pkg/common"
+	"github.com/convox/convox/pkg/sdk"
+	"github.com/convox/convox/pkg/structs"
+	"github.com/convox/stdcli"
+)
+
+// flagOutput is the shared `--output/-o` flag for commands that support
+// structured output via pkg/cli/output, in addition to their default table.
+var flagOutput = []stdcli.Flag{
+	stdcli.StringFlag("output", "o", "output format: table (default), json, yaml"),
+}
+
+func init() {
+	CLI.Command("apps", "list apps", Apps, stdcli.CommandOptions{
+		Flags:    append(flagRack, flagOutput...),
+		Validate: stdcli.Args(0),
+	})
+
+	CLI.Command("apps cancel", "cancel an app deployment", AppsCancel, stdcli.CommandOptions{
+		Flags:    append(flagRack, flagApp...),
+		Validate: stdcli.ArgsMax(1),
+	})
+
+	CLI.Command("apps create", "create an app", AppsCreate, stdcli.CommandOptions{
+		Flags:    append(flagRack, stdcli.StringFlag("generation", "g", "rack generation")),
+		Validate: stdcli.Args(1),
+	})
+
+	CLI.Command("apps delete", "delete an app", AppsDelete, stdcli.CommandOptions{
+		Flags:    append(flagRack, flagApp...),
+		Validate: stdcli.ArgsMax(1),
+	})
+
+	CLI.Command("apps export", "export an app", AppsExport, stdcli.CommandOptions{
+		Flags: append(flagRack, append(flagApp,
+			stdcli.StringFlag("file", "f", "export file"),
+			stdcli.StringFlag("format", "", "export format: tgz (default), oci"),
+			stdcli.StringFlag("sign", "", "sign the export with the given key file"),
+			stdcli.IntFlag("concurrency", "", "number of artifacts to export concurrently (default min(4, resources+1))"),
+			stdcli.BoolFlag("resume", "", "resume a previously interrupted export"),
+		)...),
+		Validate: stdcli.Args(0),
+	})
+
+	CLI.Command("apps import", "import an app", AppsImport, stdcli.CommandOptions{
+		Flags: append(flagRack, append(flagApp,
+			stdcli.StringFlag("file", "f", "import file"),
+			stdcli.StringFlag("format", "", "import format: tgz (default), oci"),
+			stdcli.StringFlag("verify", "", "verify the import against the given key file or CA certificate"),
+		)...),
+		Validate: stdcli.Args(0),
+	})
+
+	CLI.Command("apps info", "get information about an app", AppsInfo, stdcli.CommandOptions{
+		Flags:    append(flagRack, append(flagApp, flagOutput...)...),
+		Validate: stdcli.ArgsMax(1),
+	})
+
+	CLI.Command("apps params", "list app parameters", AppsParams, stdcli.CommandOptions{
+		Flags: append(flagRack, append(flagApp, append(flagOutput,
+			stdcli.BoolFlag("show-secrets", "", "show password parameter values instead of redacting them"),
+		)...)...),
+		Validate: stdcli.ArgsMax(1),
+	})
+
+	CLI.Command("apps params set", "set app parameters", AppsParamsSet, stdcli.CommandOptions{
+		Flags:    append(flagRack, flagApp...),
+		Validate: stdcli.ArgsMin(1),
+	})
+}
+
+func Apps(rack sdk.Interface, c *stdcli.Context) error {
+	as, err := rack.AppList()
+	if err != nil {
+		return err
+	}
+
+	if c.String("output") != "" && c.String("output") != output.Table {
+		r, err := output.New(c.String("output"))
+		if err != nil {
+			return err
+		}
+
+		if err := r.Render(c.Writer(), as); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	t := c.Table("APP", "STATUS", "RELEASE")
+
+	for _, a := range as {
+		t.Append(a.Name, a.Status, a.Release)
+	}
+
+	return t.Print()
+}
+
+func AppsCancel(rack sdk.Interface, c *stdcli.Context) error {
+	app, err := c.App()
+	if err != nil {
+		return err
+	}
+
+	c.Startln("Cancelling deployment of %s", app)
+
+	if err := rack.AppCancel(app); err != nil {
+		return err
+	}
+
+	return c.OK()
+}
+
+func AppsCreate(rack sdk.Interface, c *stdcli.Context) error {
+	app := c.Arg(0)
+
+	opts := structs.AppCreateOptions{}
+
+	if g := c.String("generation"); g != "" {
+		opts.Generation = &g
+	}
+
+	c.Startln("Creating %s", app)
+
+	if _, err := rack.AppCreate(app, opts); err != nil {
+		return err
+	}
+
+	if err := waitForAppRunning(rack, app); err != nil {
+		return err
+	}
+
+	return c.OK()
+}
+
+func AppsDelete(rack sdk.Interface, c *stdcli.Context) error {
+	app, err := c.App()
+	if err != nil {
+		return err
+	}
+
+	c.Startln("Deleting %s", app)
+
+	if err := rack.AppDelete(app); err != nil {
+		return err
+	}
+
+	for {
+		if _, err := rack.AppGet(app); err != nil {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return c.OK()
+}
+
+func AppsExport(rack sdk.Interface, c *stdcli.Context) error {
+	app, err := c.App()
+	if err != nil {
+		return err
+	}
+
+	file := c.String("file")
+	if file == "" {
+		file = fmt.Sprintf("%s.tgz", app)
+	}
+
+	switch c.String("format") {
+	case "oci":
+		return appsExportOCI(rack, c, app, file)
+	default:
+		return appsExportTgz(rack, c, app, file, c.String("sign"), c.Int("concurrency"), c.Bool("resume"))
+	}
+}
+
+func AppsImport(rack sdk.Interface, c *stdcli.Context) error {
+	app, err := c.App()
+	if err != nil {
+		return err
+	}
+
+	file := c.String("file")
+	if file == "" {
+		return fmt.Errorf("must specify a file to import")
+	}
+
+	switch c.String("format") {
+	case "oci":
+		return appsImportOCI(rack, c, app, file)
+	default:
+		return appsImportTgz(rack, c, app, file, c.String("verify"))
+	}
+}
+
+func appsImportTgz(rack sdk.Interface, c *stdcli.Context, app, file, verify string) error {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	gz, err := gzip.NewReader(fd)
+	if err != nil {
+		return err
+	}
+
+	if err := common.Unarchive(gz, tmp); err != nil {
+		return err
+	}
+
+	if verify != "" {
+		if err := verifyBundle(tmp, verify); err != nil {
+			return err
+		}
+	}
+
+	adata, err := ioutil.ReadFile(filepath.Join(tmp, "app.json"))
+	if err != nil {
+		return err
+	}
+
+	var a structs.App
+	if err := json.Unmarshal(adata, &a); err != nil {
+		return err
+	}
+
+	c.Startln("Creating app %s", app)
+
+	gen := a.Generation
+	if gen == "" {
+		gen = "2"
+	}
+
+	if _, err := rack.AppCreate(app, structs.AppCreateOptions{Generation: &gen}); err != nil {
+		return err
+	}
+
+	if err := waitForAppRunning(rack, app); err != nil {
+		return err
+	}
+
+	if err := c.OK(); err != nil {
+		return err
+	}
+
+	if bdata, err := ioutil.ReadFile(filepath.Join(tmp, "build.tgz")); err == nil {
+		c.Start("Importing build")
+
+		b, err := rack.BuildImport(app, strings.NewReader(string(bdata)))
+		if err != nil {
+			return err
+		}
+
+		c.OKv(b.Release)
+
+		envdata, err := ioutil.ReadFile(filepath.Join(tmp, "env"))
+		if err != nil {
+			return err
+		}
+
+		c.Start("Importing env")
+
+		env := string(envdata)
+		r, err := rack.ReleaseCreate(app, structs.ReleaseCreateOptions{Env: &env})
+		if err != nil {
+			return err
+		}
+
+		c.OKv(r.Id)
+
+		c.Startln("Promoting %s", r.Id)
+
+		if err := rack.ReleasePromote(app, r.Id, structs.ReleasePromoteOptions{}); err != nil {
+			return err
+		}
+
+		if err := waitForAppRunning(rack, app); err != nil {
+			return err
+		}
+
+		if err := c.OK(); err != nil {
+			return err
+		}
+	}
+
+	matches, err := filepath.Glob(filepath.Join(tmp, "resource.*"))
+	if err != nil {
+		return err
+	}
+
+	sidecar, err := loadResourceSidecar(tmp)
+	if err != nil {
+		return err
+	}
+
+	destTypes := map[string]string{}
+	if sidecar != nil {
+		drs, err := rack.ResourceList(app)
+		if err != nil {
+			return err
+		}
+
+		for _, dr := range drs {
+			destTypes[dr.Name] = dr.Type
+		}
+	}
+
+	for _, m := range matches {
+		name := strings.TrimPrefix(filepath.Base(m), "resource.")
+
+		if entry, ok := sidecar[name]; ok {
+			if destType, ok := destTypes[name]; ok && destType != entry.Type {
+				return fmt.Errorf("resource %s: cannot import %s data into a %s resource", name, entry.Type, destType)
+			}
+		}
+
+		c.Startln("Importing resource %s", name)
+
+		rd, err := os.Open(m)
+		if err != nil {
+			return err
+		}
+
+		resType := ""
+		if entry, ok := sidecar[name]; ok {
+			resType = entry.Type
+		}
+
+		var buf bytes.Buffer
+		err = resource.Lookup(resType).Import(&buf, rd)
+		rd.Close()
+		if err != nil {
+			return err
+		}
+
+		if err := rack.ResourceImport(app, name, &buf); err != nil {
+			return err
+		}
+
+		if err := c.OK(); err != nil {
+			return err
+		}
+	}
+
+	if pdata, err := ioutil.ReadFile(filepath.Join(tmp, "app.json")); err == nil {
+		var pa structs.App
+		if err := json.Unmarshal(pdata, &pa); err == nil && len(pa.Parameters) > 0 {
+			current, err := rack.AppGet(app)
+			if err != nil {
+				return err
+			}
+
+			if !paramsEqual(current.Parameters, pa.Parameters) {
+				c.Startln("Updating parameters")
+
+				if err := rack.AppUpdate(app, structs.AppUpdateOptions{Parameters: pa.Parameters}); err != nil {
+					return err
+				}
+
+				if err := waitForAppRunning(rack, app); err != nil {
+					return err
+				}
+
+				if err := c.OK(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func paramsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range b {
+		if a[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func AppsInfo(rack sdk.Interface, c *stdcli.Context) error {
+	app, err := c.App()
+	if err != nil {
+		return err
+	}
+
+	a, err := rack.AppGet(app)
+	if err != nil {
+		return err
+	}
+
+	if format := c.String("output"); format != "" && format != output.Table {
+		r, err := output.New(format)
+		if err != nil {
+			return err
+		}
+
+		return r.Render(c.Writer(), a)
+	}
+
+	i := c.Info()
+
+	i.Add("Name", a.Name)
+	i.Add("Status", a.Status)
+	i.Add("Generation", a.Generation)
+	i.Add("Locked", fmt.Sprintf("%t", a.Locked))
+	i.Add("Release", a.Release)
+
+	if a.Router != "" {
+		i.Add("Router", a.Router)
+	}
+
+	return i.Print()
+}
+
+func AppsParams(rack sdk.Interface, c *stdcli.Context) error {
+	app, err := c.App()
+	if err != nil {
+		return err
+	}
+
+	params, err := appParameters(rack, app)
+	if err != nil {
+		return err
+	}
+
+	redacted := params
+	if !c.Bool("show-secrets") {
+		redacted = map[string]string{}
+		for k, v := range params {
+			if strings.Contains(strings.ToLower(k), "password") {
+				v = "****"
+			}
+			redacted[k] = v
+		}
+	}
+
+	if format := c.String("output"); format != "" && format != output.Table {
+		r, err := output.New(format)
+		if err != nil {
+			return err
+		}
+
+		return r.Render(c.Writer(), redacted)
+	}
+
+	keys := make([]string, 0, len(redacted))
+	for k := range redacted {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	i := c.Info()
+
+	for _, k := range keys {
+		i.Add(k, redacted[k])
+	}
+
+	return i.Print()
+}
+
+func appParameters(rack sdk.Interface, app string) (map[string]string, error) {
+	s, err := rack.SystemGet()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Version == "classic" {
+		return rack.AppParametersGet(app)
+	}
+
+	a, err := rack.AppGet(app)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.Parameters, nil
+}
+
+func AppsParamsSet(rack sdk.Interface, c *stdcli.Context) error {
+	app, err := c.App()
+	if err != nil {
+		return err
+	}
+
+	params := map[string]string{}
+
+	for _, arg := range c.Args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid parameter: %s", arg)
+		}
+		params[parts[0]] = parts[1]
+	}
+
+	c.Start("Updating parameters")
+
+	s, err := rack.SystemGet()
+	if err != nil {
+		return err
+	}
+
+	if s.Version == "classic" {
+		err = rack.AppParametersSet(app, params)
+	} else {
+		err = rack.AppUpdate(app, structs.AppUpdateOptions{Parameters: params})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := waitForAppRunning(rack, app); err != nil {
+		return err
+	}
+
+	return c.OK()
+}
+
+func waitForAppRunning(rack sdk.Interface, app string) error {
+	for {
+		a, err := rack.AppGet(app)
+		if err != nil {
+			return err
+		}
+
+		if a.Status != "creating" && a.Status != "updating" {
+			return nil
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
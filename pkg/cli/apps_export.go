@@ -0,0 +1,415 @@
+package cli
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/convox/convox/pkg/cli/resource"
+	"github.com/convox/convox/pkg/common"
+	"github.com/convox/convox/pkg/sdk"
+	"github.com/convox/convox/pkg/structs"
+	"github.com/convox/stdcli"
+)
+
+// exportArtifact is one entry in a staged export's sidecar manifest: the
+// digest convox uses to decide, on --resume, whether a staged file can be
+// reused as-is.
+type exportArtifact struct {
+	Sha256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// exportManifest is the sidecar app.manifest.json written incrementally
+// alongside a staged export, keyed by staged filename.
+type exportManifest struct {
+	mu       sync.Mutex
+	dir      string
+	path     string
+	Artifact map[string]exportArtifact `json:"artifacts"`
+}
+
+func loadExportManifest(path string) *exportManifest {
+	m := &exportManifest{dir: filepath.Dir(path), path: path, Artifact: map[string]exportArtifact{}}
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, m)
+	}
+
+	return m
+}
+
+func (m *exportManifest) set(name, sha256sum string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Artifact[name] = exportArtifact{Sha256: sha256sum, Size: size}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(m.path, data, 0644)
+}
+
+func (m *exportManifest) complete() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, a := range m.Artifact {
+		sum, size, err := sha256File(filepath.Join(m.dir, name))
+		if err != nil || sum != a.Sha256 || size != a.Size {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resourceSidecarEntry describes one resource blob staged into an export
+// bundle, so `apps import` can tell what it is before handing it to the
+// destination resource.
+type resourceSidecarEntry struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	ContentType string `json:"content_type"`
+	Sha256      string `json:"sha256"`
+	Size        int64  `json:"size"`
+}
+
+// writeResourceSidecar records resources.json, the manifest of resource
+// blobs in the bundle, so an import can validate each blob's declared
+// type against its destination resource before importing it.
+func writeResourceSidecar(dir string, rs structs.Resources, manifest *exportManifest) error {
+	entries := make([]resourceSidecarEntry, len(rs))
+
+	for i, res := range rs {
+		name := fmt.Sprintf("resource.%s", res.Name)
+
+		manifest.mu.Lock()
+		a := manifest.Artifact[name]
+		manifest.mu.Unlock()
+
+		entries[i] = resourceSidecarEntry{
+			Name:        res.Name,
+			Type:        res.Type,
+			ContentType: resource.Lookup(res.Type).ContentType(),
+			Sha256:      a.Sha256,
+			Size:        a.Size,
+		}
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, "resources.json"), data, 0644)
+}
+
+// loadResourceSidecar reads resources.json from a bundle, keyed by
+// resource name. Bundles exported before resources.json existed have no
+// such file, so a missing file is not an error: it just means import
+// skips the destination-type check.
+func loadResourceSidecar(dir string) (map[string]resourceSidecarEntry, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "resources.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []resourceSidecarEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	byName := map[string]resourceSidecarEntry{}
+	for _, e := range entries {
+		byName[e.Name] = e
+	}
+
+	return byName, nil
+}
+
+// exportJob is one artifact produced by `apps export`: env, the build, or a
+// single resource (app.json is staged before the jobs start). Jobs run
+// concurrently on a bounded pool;
+// their progress lines are printed afterward, in this canonical order, so
+// output stays stable regardless of which job finishes first.
+type exportJob struct {
+	label string
+	path  string
+	write func(ctx context.Context, w io.Writer) error
+}
+
+// appsExportTgz stages every artifact into a `<file>.staging` directory,
+// running up to concurrency of them at once (default min(4, len(resources)+1)),
+// then packages the staging directory into file once every artifact is
+// present and digest-verified. On --resume, any staged artifact whose
+// sha256 already matches the sidecar app.manifest.json is reused instead of
+// re-exported, so an interrupted multi-GB export can pick up where it left
+// off.
+func appsExportTgz(rack sdk.Interface, c *stdcli.Context, app, file, sign string, concurrency int, resume bool) error {
+	staging := file + ".staging"
+
+	if !resume {
+		os.RemoveAll(staging)
+	}
+
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return err
+	}
+
+	manifest := loadExportManifest(filepath.Join(staging, "app.manifest.json"))
+
+	succeeded := false
+	defer func() {
+		if succeeded {
+			os.RemoveAll(staging)
+		}
+	}()
+
+	c.Startln("Exporting app %s", app)
+
+	a, err := rack.AppGet(app)
+	if err != nil {
+		return err
+	}
+
+	adata, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	if err := stageArtifact(manifest, resume, filepath.Join(staging, "app.json"), func(_ context.Context, w io.Writer) error {
+		_, err := w.Write(adata)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := c.OK(); err != nil {
+		return err
+	}
+
+	r, err := rack.ReleaseGet(app, a.Release)
+	if err != nil {
+		return err
+	}
+
+	rs, err := rack.ResourceList(app)
+	if err != nil {
+		return err
+	}
+
+	if concurrency <= 0 {
+		concurrency = len(rs) + 1
+		if concurrency > 4 {
+			concurrency = 4
+		}
+	}
+
+	jobs := []exportJob{
+		{
+			label: "Exporting env",
+			path:  filepath.Join(staging, "env"),
+			write: func(_ context.Context, w io.Writer) error {
+				_, err := w.Write([]byte(r.Env))
+				return err
+			},
+		},
+	}
+
+	if r.Build != "" {
+		jobs = append(jobs, exportJob{
+			label: fmt.Sprintf("Exporting build %s", r.Build),
+			path:  filepath.Join(staging, "build.tgz"),
+			write: func(_ context.Context, w io.Writer) error {
+				return rack.BuildExport(app, r.Build, w)
+			},
+		})
+	}
+
+	for _, res := range rs {
+		res := res
+
+		jobs = append(jobs, exportJob{
+			label: fmt.Sprintf("Exporting resource %s", res.Name),
+			path:  filepath.Join(staging, fmt.Sprintf("resource.%s", res.Name)),
+			write: func(_ context.Context, w io.Writer) error {
+				rd, err := rack.ResourceExport(app, res.Name)
+				if err != nil {
+					return err
+				}
+				defer rd.Close()
+
+				return resource.Lookup(res.Type).Export(w, rd)
+			},
+		})
+	}
+
+	if err := runExportJobs(jobs, concurrency, manifest, resume); err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		c.Startln(job.label)
+
+		if err := c.OK(); err != nil {
+			return err
+		}
+	}
+
+	if len(rs) > 0 {
+		if err := writeResourceSidecar(staging, rs, manifest); err != nil {
+			return err
+		}
+	}
+
+	if sign != "" {
+		if err := signBundle(staging, sign); err != nil {
+			return err
+		}
+	}
+
+	if !manifest.complete() {
+		return fmt.Errorf("export incomplete: one or more artifacts failed digest verification")
+	}
+
+	c.Startln("Packaging export")
+
+	part := file + ".part"
+
+	if err := packageTgz(staging, part); err != nil {
+		return err
+	}
+
+	if err := os.Rename(part, file); err != nil {
+		return err
+	}
+
+	succeeded = true
+
+	return c.OK()
+}
+
+// runExportJobs runs jobs concurrently, up to concurrency at a time. Once
+// a job errors, jobs that have not started yet are skipped; jobs already
+// running are not interrupted and are waited for. It then returns the
+// error of the earliest failed job in jobs order.
+func runExportJobs(jobs []exportJob, concurrency int, manifest *exportManifest, resume bool) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sem := make(chan struct{}, concurrency)
+	errs := make([]error, len(jobs))
+
+	var wg sync.WaitGroup
+
+	for i, job := range jobs {
+		i, job := i, job
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err := stageArtifact(manifest, resume, job.path, job.write); err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stageArtifact writes the bytes produced by write to path, computing its
+// sha256 digest and size as they stream through so large artifacts are
+// never buffered, then records the digest in manifest. If resume is true
+// and path already matches a previously recorded digest, the write is
+// skipped entirely.
+func stageArtifact(manifest *exportManifest, resume bool, path string, write func(ctx context.Context, w io.Writer) error) error {
+	name := filepath.Base(path)
+
+	if resume {
+		manifest.mu.Lock()
+		a, ok := manifest.Artifact[name]
+		manifest.mu.Unlock()
+
+		if ok {
+			if sum, size, err := sha256File(path); err == nil && sum == a.Sha256 && size == a.Size {
+				return nil
+			}
+		}
+	}
+
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	cw := &countingWriter{}
+
+	if err := write(context.Background(), io.MultiWriter(fd, h, cw)); err != nil {
+		fd.Close()
+		return err
+	}
+
+	if err := fd.Close(); err != nil {
+		return err
+	}
+
+	return manifest.set(name, hex.EncodeToString(h.Sum(nil)), cw.n)
+}
+
+// packageTgz archives dir into file as a gzip-compressed tar. app.manifest.json
+// is a staging-only sidecar used for --resume bookkeeping and unsigned by
+// bundleManifest, so it's set aside for the duration of the archive instead
+// of shipping inside the distributable bundle.
+func packageTgz(dir, file string) error {
+	manifest := filepath.Join(dir, "app.manifest.json")
+	hidden := filepath.Join(filepath.Dir(dir), filepath.Base(dir)+".manifest.json.bak")
+
+	if err := os.Rename(manifest, hidden); err != nil {
+		return err
+	}
+	defer os.Rename(hidden, manifest)
+
+	fd, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	gz := gzip.NewWriter(fd)
+	defer gz.Close()
+
+	return common.Archive(gz, dir)
+}
@@ -0,0 +1,120 @@
+package cli_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/convox/convox/pkg/cli"
+	"github.com/convox/convox/pkg/common"
+	mocksdk "github.com/convox/convox/pkg/mock/sdk"
+	"github.com/convox/convox/pkg/structs"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppsExportConcurrent(t *testing.T) {
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+		i.On("ReleaseGet", "app1", "release1").Return(fxRelease(), nil)
+		bdata, err := ioutil.ReadFile("testdata/build.tgz")
+		require.NoError(t, err)
+		i.On("BuildExport", "app1", "build1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			args.Get(2).(io.Writer).Write(bdata)
+		})
+		i.On("ResourceList", "app1").Return(structs.Resources{*fxResource()}, nil)
+		rdata, err := ioutil.ReadFile("testdata/resource.export")
+		require.NoError(t, err)
+		i.On("ResourceExport", "app1", "resource1").Return(ioutil.NopCloser(bytes.NewReader(rdata)), nil)
+
+		tmp, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer os.RemoveAll(tmp)
+
+		dest := filepath.Join(tmp, "app.tgz")
+
+		res, err := testExecute(e, fmt.Sprintf("apps export -a app1 -f %s --concurrency 2", dest), nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+		res.RequireStderr(t, []string{""})
+		res.RequireStdout(t, []string{
+			"Exporting app app1... OK",
+			"Exporting env... OK",
+			"Exporting build build1... OK",
+			"Exporting resource resource1... OK",
+			"Packaging export... OK",
+		})
+
+		_, err = os.Stat(dest)
+		require.NoError(t, err)
+
+		_, err = os.Stat(dest + ".staging")
+		require.True(t, os.IsNotExist(err))
+
+		fd, err := os.Open(dest)
+		require.NoError(t, err)
+		defer fd.Close()
+
+		gz, err := gzip.NewReader(fd)
+		require.NoError(t, err)
+		require.NoError(t, common.Unarchive(gz, tmp))
+
+		_, err = os.Stat(filepath.Join(tmp, "app.manifest.json"))
+		require.True(t, os.IsNotExist(err), "app.manifest.json is a staging-only sidecar and must not ship in the bundle")
+	})
+}
+
+func TestAppsExportResume(t *testing.T) {
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+		i.On("ReleaseGet", "app1", "release1").Return(fxRelease(), nil)
+		bdata, err := ioutil.ReadFile("testdata/build.tgz")
+		require.NoError(t, err)
+		i.On("BuildExport", "app1", "build1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			args.Get(2).(io.Writer).Write(bdata)
+		})
+		i.On("ResourceList", "app1").Return(structs.Resources{*fxResource()}, nil)
+		rdata, err := ioutil.ReadFile("testdata/resource.export")
+		require.NoError(t, err)
+		// ResourceExport is deliberately NOT stubbed: the resource is
+		// pre-staged below, so a resumed export must not call it again.
+
+		tmp, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer os.RemoveAll(tmp)
+
+		dest := filepath.Join(tmp, "app.tgz")
+		staging := dest + ".staging"
+		require.NoError(t, os.MkdirAll(staging, 0755))
+
+		resourcePath := filepath.Join(staging, "resource.resource1")
+		require.NoError(t, ioutil.WriteFile(resourcePath, rdata, 0644))
+
+		sum := sha256.Sum256(rdata)
+		manifest := map[string]interface{}{
+			"artifacts": map[string]interface{}{
+				"resource.resource1": map[string]interface{}{
+					"sha256": hex.EncodeToString(sum[:]),
+					"size":   len(rdata),
+				},
+			},
+		}
+		mdata, err := json.Marshal(manifest)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(staging, "app.manifest.json"), mdata, 0644))
+
+		res, err := testExecute(e, fmt.Sprintf("apps export -a app1 -f %s --resume", dest), nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+
+		i.AssertNotCalled(t, "ResourceExport", "app1", "resource1")
+	})
+}
@@ -0,0 +1,467 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/convox/convox/pkg/cli/resource"
+	"github.com/convox/convox/pkg/sdk"
+	"github.com/convox/convox/pkg/structs"
+	"github.com/convox/stdcli"
+)
+
+// OCI media and artifact types used by the `apps export --format oci` /
+// `apps import --format oci` bundle. The bundle is a standard OCI Image
+// Layout: a manifest tagged with a Convox-specific artifactType, an env
+// config blob, a build layer, and one layer per resource export.
+const (
+	ociMediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	ociMediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	ociMediaTypeImageLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociMediaTypeConvoxEnv     = "application/vnd.convox.env.v1"
+	ociArtifactTypeConvoxApp  = "application/vnd.convox.app.v1+json"
+
+	ociAnnotationAppName             = "com.convox.app.name"
+	ociAnnotationAppGeneration       = "com.convox.app.generation"
+	ociAnnotationAppParameters       = "com.convox.app.parameters"
+	ociAnnotationResourceName        = "com.convox.resource.name"
+	ociAnnotationResourceType        = "com.convox.resource.type"
+	ociAnnotationResourceContentType = "com.convox.resource.contentType"
+)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+func appsExportOCI(rack sdk.Interface, c *stdcli.Context, app, dest string) error {
+	parent := filepath.Dir(dest)
+
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+
+	root, err := ioutil.TempDir(parent, ".oci-export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		return err
+	}
+
+	c.Startln("Exporting app %s", app)
+
+	a, err := rack.AppGet(app)
+	if err != nil {
+		return err
+	}
+
+	if err := c.OK(); err != nil {
+		return err
+	}
+
+	c.Startln("Exporting env")
+
+	r, err := rack.ReleaseGet(app, a.Release)
+	if err != nil {
+		return err
+	}
+
+	envDesc, err := writeOCIBlob(root, ociMediaTypeConvoxEnv, func(w io.Writer) error {
+		_, err := w.Write([]byte(r.Env))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := c.OK(); err != nil {
+		return err
+	}
+
+	manifest := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociMediaTypeImageManifest,
+		ArtifactType:  ociArtifactTypeConvoxApp,
+		Config:        envDesc,
+		Annotations:   ociAppAnnotations(a),
+	}
+
+	if r.Build != "" {
+		c.Startln("Exporting build %s", r.Build)
+
+		layer, err := writeOCIBlob(root, ociMediaTypeImageLayer, func(w io.Writer) error {
+			return rack.BuildExport(app, r.Build, w)
+		})
+		if err != nil {
+			return err
+		}
+
+		manifest.Layers = append(manifest.Layers, layer)
+
+		if err := c.OK(); err != nil {
+			return err
+		}
+	}
+
+	rs, err := rack.ResourceList(app)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range rs {
+		c.Startln("Exporting resource %s", res.Name)
+
+		layer, err := writeOCIBlob(root, ociMediaTypeImageLayer, func(w io.Writer) error {
+			rd, err := rack.ResourceExport(app, res.Name)
+			if err != nil {
+				return err
+			}
+			defer rd.Close()
+
+			return resource.Lookup(res.Type).Export(w, rd)
+		})
+		if err != nil {
+			return err
+		}
+
+		layer.Annotations = map[string]string{
+			ociAnnotationResourceName:        res.Name,
+			ociAnnotationResourceType:        res.Type,
+			ociAnnotationResourceContentType: resource.Lookup(res.Type).ContentType(),
+		}
+		manifest.Layers = append(manifest.Layers, layer)
+
+		if err := c.OK(); err != nil {
+			return err
+		}
+	}
+
+	c.Startln("Packaging export")
+
+	mdata, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	manifestDesc, err := writeOCIBlob(root, ociMediaTypeImageManifest, func(w io.Writer) error {
+		_, err := w.Write(mdata)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	index := ociIndex{
+		SchemaVersion: 2,
+		MediaType:     ociMediaTypeImageIndex,
+		Manifests:     []ociDescriptor{manifestDesc},
+	}
+
+	idata, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "index.json"), idata, 0644); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+
+	if err := os.Rename(root, dest); err != nil {
+		return err
+	}
+
+	return c.OK()
+}
+
+func appsImportOCI(rack sdk.Interface, c *stdcli.Context, app, src string) error {
+	idata, err := ioutil.ReadFile(filepath.Join(src, "index.json"))
+	if err != nil {
+		return err
+	}
+
+	var index ociIndex
+	if err := json.Unmarshal(idata, &index); err != nil {
+		return err
+	}
+
+	if len(index.Manifests) == 0 {
+		return fmt.Errorf("no manifests found in %s", src)
+	}
+
+	mdata, err := readOCIBlob(src, index.Manifests[0])
+	if err != nil {
+		return err
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(mdata, &manifest); err != nil {
+		return err
+	}
+
+	envdata, err := readOCIBlob(src, manifest.Config)
+	if err != nil {
+		return err
+	}
+
+	gen := manifest.Annotations[ociAnnotationAppGeneration]
+	if gen == "" {
+		gen = "2"
+	}
+
+	c.Startln("Creating app %s", app)
+
+	if _, err := rack.AppCreate(app, structs.AppCreateOptions{Generation: &gen}); err != nil {
+		return err
+	}
+
+	if err := waitForAppRunning(rack, app); err != nil {
+		return err
+	}
+
+	if err := c.OK(); err != nil {
+		return err
+	}
+
+	var buildLayer *ociDescriptor
+	var resourceLayers []ociDescriptor
+
+	for i, l := range manifest.Layers {
+		if name := l.Annotations[ociAnnotationResourceName]; name != "" {
+			resourceLayers = append(resourceLayers, l)
+		} else if buildLayer == nil {
+			buildLayer = &manifest.Layers[i]
+		}
+	}
+
+	if buildLayer != nil {
+		c.Start("Importing build")
+
+		bdata, err := readOCIBlob(src, *buildLayer)
+		if err != nil {
+			return err
+		}
+
+		b, err := rack.BuildImport(app, bytes.NewReader(bdata))
+		if err != nil {
+			return err
+		}
+
+		c.OKv(b.Release)
+
+		c.Start("Importing env")
+
+		env := string(envdata)
+
+		rel, err := rack.ReleaseCreate(app, structs.ReleaseCreateOptions{Env: &env})
+		if err != nil {
+			return err
+		}
+
+		c.OKv(rel.Id)
+
+		c.Startln("Promoting %s", rel.Id)
+
+		if err := rack.ReleasePromote(app, rel.Id, structs.ReleasePromoteOptions{}); err != nil {
+			return err
+		}
+
+		if err := waitForAppRunning(rack, app); err != nil {
+			return err
+		}
+
+		if err := c.OK(); err != nil {
+			return err
+		}
+	}
+
+	destTypes := map[string]string{}
+	if len(resourceLayers) > 0 {
+		drs, err := rack.ResourceList(app)
+		if err != nil {
+			return err
+		}
+
+		for _, dr := range drs {
+			destTypes[dr.Name] = dr.Type
+		}
+	}
+
+	for _, l := range resourceLayers {
+		name := l.Annotations[ociAnnotationResourceName]
+		resType := l.Annotations[ociAnnotationResourceType]
+
+		if destType, ok := destTypes[name]; ok && resType != "" && destType != resType {
+			return fmt.Errorf("resource %s: cannot import %s data into a %s resource", name, resType, destType)
+		}
+
+		c.Startln("Importing resource %s", name)
+
+		rdata, err := readOCIBlob(src, l)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		if err := resource.Lookup(resType).Import(&buf, bytes.NewReader(rdata)); err != nil {
+			return err
+		}
+
+		if err := rack.ResourceImport(app, name, &buf); err != nil {
+			return err
+		}
+
+		if err := c.OK(); err != nil {
+			return err
+		}
+	}
+
+	if pdata := manifest.Annotations[ociAnnotationAppParameters]; pdata != "" {
+		var params map[string]string
+		if err := json.Unmarshal([]byte(pdata), &params); err != nil {
+			return err
+		}
+
+		current, err := rack.AppGet(app)
+		if err != nil {
+			return err
+		}
+
+		if !paramsEqual(current.Parameters, params) {
+			c.Startln("Updating parameters")
+
+			if err := rack.AppUpdate(app, structs.AppUpdateOptions{Parameters: params}); err != nil {
+				return err
+			}
+
+			if err := waitForAppRunning(rack, app); err != nil {
+				return err
+			}
+
+			if err := c.OK(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func ociAppAnnotations(a *structs.App) map[string]string {
+	ann := map[string]string{
+		ociAnnotationAppName:       a.Name,
+		ociAnnotationAppGeneration: a.Generation,
+	}
+
+	if len(a.Parameters) > 0 {
+		if pdata, err := json.Marshal(a.Parameters); err == nil {
+			ann[ociAnnotationAppParameters] = string(pdata)
+		}
+	}
+
+	return ann
+}
+
+// writeOCIBlob streams the bytes produced by write into a content-addressed
+// blob under root/blobs/sha256, computing the sha256 digest as the data
+// passes through so callers never need to buffer it in memory.
+func writeOCIBlob(root, mediaType string, write func(w io.Writer) error) (ociDescriptor, error) {
+	dir := filepath.Join(root, "blobs", "sha256")
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ociDescriptor{}, err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "blob-")
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	h := sha256.New()
+	cw := &countingWriter{}
+
+	if err := write(io.MultiWriter(tmp, h, cw)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return ociDescriptor{}, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return ociDescriptor{}, err
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, digest)); err != nil {
+		return ociDescriptor{}, err
+	}
+
+	return ociDescriptor{
+		MediaType: mediaType,
+		Digest:    fmt.Sprintf("sha256:%s", digest),
+		Size:      cw.n,
+	}, nil
+}
+
+// readOCIBlob reads a blob by descriptor and verifies its sha256 digest and
+// size before returning its contents.
+func readOCIBlob(root string, d ociDescriptor) ([]byte, error) {
+	digest := strings.TrimPrefix(d.Digest, "sha256:")
+
+	data, err := ioutil.ReadFile(filepath.Join(root, "blobs", "sha256", digest))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) != d.Size {
+		return nil, fmt.Errorf("size mismatch for blob sha256:%s", digest)
+	}
+
+	sum := sha256.Sum256(data)
+
+	if hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("digest mismatch for blob sha256:%s", digest)
+	}
+
+	return data, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
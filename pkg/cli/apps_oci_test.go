@@ -0,0 +1,111 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/convox/convox/pkg/cli"
+	mocksdk "github.com/convox/convox/pkg/mock/sdk"
+	"github.com/convox/convox/pkg/structs"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppsExportOCI(t *testing.T) {
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+		i.On("ReleaseGet", "app1", "release1").Return(fxRelease(), nil)
+		bdata, err := ioutil.ReadFile("testdata/build.tgz")
+		require.NoError(t, err)
+		i.On("BuildExport", "app1", "build1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			args.Get(2).(io.Writer).Write(bdata)
+		})
+		i.On("ResourceList", "app1").Return(structs.Resources{*fxResource()}, nil)
+		rdata, err := ioutil.ReadFile("testdata/resource.export")
+		require.NoError(t, err)
+		i.On("ResourceExport", "app1", "resource1").Return(ioutil.NopCloser(bytes.NewReader(rdata)), nil)
+
+		tmp, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer os.RemoveAll(tmp)
+
+		dest := filepath.Join(tmp, "app-oci")
+
+		res, err := testExecute(e, fmt.Sprintf("apps export -a app1 -f %s --format oci", dest), nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+		res.RequireStderr(t, []string{""})
+		res.RequireStdout(t, []string{
+			"Exporting app app1... OK",
+			"Exporting env... OK",
+			"Exporting build build1... OK",
+			"Exporting resource resource1... OK",
+			"Packaging export... OK",
+		})
+
+		_, err = os.Stat(filepath.Join(dest, "oci-layout"))
+		require.NoError(t, err)
+
+		idata, err := ioutil.ReadFile(filepath.Join(dest, "index.json"))
+		require.NoError(t, err)
+
+		var index struct {
+			Manifests []struct {
+				Digest string `json:"digest"`
+			} `json:"manifests"`
+		}
+		require.NoError(t, json.Unmarshal(idata, &index))
+		require.Len(t, index.Manifests, 1)
+
+		entries, err := ioutil.ReadDir(filepath.Join(dest, "blobs", "sha256"))
+		require.NoError(t, err)
+		require.True(t, len(entries) >= 3) // manifest + env + build (+ resource)
+	})
+}
+
+func TestAppsImportOCI(t *testing.T) {
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+		i.On("ReleaseGet", "app1", "release1").Return(fxRelease(), nil)
+		bdata, err := ioutil.ReadFile("testdata/build.tgz")
+		require.NoError(t, err)
+		i.On("BuildExport", "app1", "build1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			args.Get(2).(io.Writer).Write(bdata)
+		})
+		i.On("ResourceList", "app1").Return(structs.Resources{*fxResource()}, nil)
+		rdata, err := ioutil.ReadFile("testdata/resource.export")
+		require.NoError(t, err)
+		i.On("ResourceExport", "app1", "resource1").Return(ioutil.NopCloser(bytes.NewReader(rdata)), nil)
+
+		tmp, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer os.RemoveAll(tmp)
+
+		dest := filepath.Join(tmp, "app-oci")
+
+		res, err := testExecute(e, fmt.Sprintf("apps export -a app1 -f %s --format oci", dest), nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+
+		i.On("AppCreate", "app1", mock.Anything).Return(fxApp(), nil)
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+		i.On("BuildImport", "app1", mock.Anything).Return(fxBuild(), nil)
+		i.On("ReleaseCreate", "app1", mock.Anything).Return(fxRelease(), nil)
+		i.On("ReleasePromote", "app1", "release1", mock.Anything).Return(nil)
+		i.On("ResourceImport", "app1", "resource1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			got, err := ioutil.ReadAll(args.Get(2).(io.Reader))
+			require.NoError(t, err)
+			require.Equal(t, rdata, got)
+		})
+
+		res, err = testExecute(e, fmt.Sprintf("apps import -a app1 -f %s --format oci", dest), nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+	})
+}
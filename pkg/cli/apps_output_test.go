@@ -0,0 +1,71 @@
+package cli_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/convox/convox/pkg/cli"
+	mocksdk "github.com/convox/convox/pkg/mock/sdk"
+	"github.com/convox/convox/pkg/structs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppsOutput(t *testing.T) {
+	for _, format := range []string{"", "json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+				i.On("AppList").Return(structs.Apps{*fxApp()}, nil)
+
+				cmd := "apps"
+				if format != "" {
+					cmd = fmt.Sprintf("apps -o %s", format)
+				}
+
+				res, err := testExecute(e, cmd, nil)
+				require.NoError(t, err)
+				require.Equal(t, 0, res.Code)
+			})
+		})
+	}
+}
+
+func TestAppsInfoOutput(t *testing.T) {
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+
+		res, err := testExecute(e, "apps info app1 -o yaml", nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+	})
+
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+
+		res, err := testExecute(e, "apps info app1 -o json", nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+	})
+}
+
+func TestAppsParamsOutput(t *testing.T) {
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("SystemGet").Return(fxSystem(), nil)
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+
+		res, err := testExecute(e, "apps params app1 -o json", nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+		require.Contains(t, strings.Join(res.Stdout, "\n"), `"ParamPassword":"****"`)
+	})
+
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("SystemGet").Return(fxSystem(), nil)
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+
+		res, err := testExecute(e, "apps params app1 -o json --show-secrets", nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+		require.NotContains(t, strings.Join(res.Stdout, "\n"), `"ParamPassword":"****"`)
+	})
+}
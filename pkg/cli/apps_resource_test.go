@@ -0,0 +1,109 @@
+package cli_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/convox/convox/pkg/cli"
+	"github.com/convox/convox/pkg/common"
+	mocksdk "github.com/convox/convox/pkg/mock/sdk"
+	"github.com/convox/convox/pkg/structs"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppsExportResourceSidecar(t *testing.T) {
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+
+		rel := fxRelease()
+		rel.Build = ""
+		i.On("ReleaseGet", "app1", "release1").Return(rel, nil)
+
+		rs := structs.Resources{
+			{Name: "db1", Type: "postgres"},
+			{Name: "cache1", Type: "redis"},
+		}
+		i.On("ResourceList", "app1").Return(rs, nil)
+		i.On("ResourceExport", "app1", "db1").Return(ioutil.NopCloser(bytes.NewReader([]byte("pgdump"))), nil)
+		i.On("ResourceExport", "app1", "cache1").Return(ioutil.NopCloser(bytes.NewReader([]byte("rdbdump"))), nil)
+
+		tmp, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer os.RemoveAll(tmp)
+
+		dest := filepath.Join(tmp, "app.tgz")
+
+		res, err := testExecute(e, fmt.Sprintf("apps export -a app1 -f %s", dest), nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+
+		fd, err := os.Open(dest)
+		require.NoError(t, err)
+		defer fd.Close()
+
+		gz, err := gzip.NewReader(fd)
+		require.NoError(t, err)
+		require.NoError(t, common.Unarchive(gz, tmp))
+
+		data, err := ioutil.ReadFile(filepath.Join(tmp, "resources.json"))
+		require.NoError(t, err)
+
+		var entries []struct {
+			Name        string `json:"name"`
+			Type        string `json:"type"`
+			ContentType string `json:"content_type"`
+		}
+		require.NoError(t, json.Unmarshal(data, &entries))
+		require.Len(t, entries, 2)
+
+		contentTypes := map[string]string{}
+		for _, en := range entries {
+			contentTypes[en.Name] = en.ContentType
+		}
+		require.Equal(t, "application/x-postgres-dump", contentTypes["db1"])
+		require.Equal(t, "application/vnd.convox.redis-rdb", contentTypes["cache1"])
+	})
+}
+
+func TestAppsImportResourceTypeMismatch(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	dest := filepath.Join(tmp, "app.tgz")
+
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+
+		rel := fxRelease()
+		rel.Build = ""
+		i.On("ReleaseGet", "app1", "release1").Return(rel, nil)
+
+		i.On("ResourceList", "app1").Return(structs.Resources{{Name: "db1", Type: "postgres"}}, nil)
+		i.On("ResourceExport", "app1", "db1").Return(ioutil.NopCloser(bytes.NewReader([]byte("pgdump"))), nil)
+
+		res, err := testExecute(e, fmt.Sprintf("apps export -a app1 -f %s", dest), nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+	})
+
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppCreate", "app1", mock.Anything).Return(fxApp(), nil)
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+		i.On("ResourceList", "app1").Return(structs.Resources{{Name: "db1", Type: "mysql"}}, nil)
+
+		res, err := testExecute(e, fmt.Sprintf("apps import -a app1 -f %s", dest), nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, res.Code)
+		res.RequireStderr(t, []string{"ERROR: resource db1: cannot import postgres data into a mysql resource"})
+
+		i.AssertNotCalled(t, "ResourceImport", "app1", "db1", mock.Anything)
+	})
+}
@@ -0,0 +1,278 @@
+package cli_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/convox/convox/pkg/cli"
+	"github.com/convox/convox/pkg/common"
+	mocksdk "github.com/convox/convox/pkg/mock/sdk"
+	"github.com/convox/convox/pkg/structs"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppsExportSignAndImportVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	tmp, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	keyfile := filepath.Join(tmp, "app.key")
+	require.NoError(t, ioutil.WriteFile(keyfile, priv, 0600))
+
+	pubfile := filepath.Join(tmp, "app.pub")
+	require.NoError(t, ioutil.WriteFile(pubfile, pub, 0644))
+
+	bundle := filepath.Join(tmp, "app.tgz")
+	exportSignedBundle(t, bundle, keyfile)
+
+	// valid signature
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		stubImport(i)
+
+		res, err := testExecute(e, fmt.Sprintf("apps import -a app1 -f %s --verify %s", bundle, pubfile), nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+	})
+
+	// tampered build.tgz
+	tamperedBuild := filepath.Join(tmp, "app.tampered-build.tgz")
+	corruptBundleEntry(t, bundle, tamperedBuild, "build.tgz")
+
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		res, err := testExecute(e, fmt.Sprintf("apps import -a app1 -f %s --verify %s", tamperedBuild, pubfile), nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, res.Code)
+		res.RequireStderr(t, []string{"ERROR: signature verification failed: signature does not match bundle contents"})
+	})
+
+	// tampered env
+	tamperedEnv := filepath.Join(tmp, "app.tampered-env.tgz")
+	corruptBundleEntry(t, bundle, tamperedEnv, "env")
+
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		res, err := testExecute(e, fmt.Sprintf("apps import -a app1 -f %s --verify %s", tamperedEnv, pubfile), nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, res.Code)
+		res.RequireStderr(t, []string{"ERROR: signature verification failed: signature does not match bundle contents"})
+	})
+
+	// tampered resources.json
+	tamperedResources := filepath.Join(tmp, "app.tampered-resources.tgz")
+	corruptBundleEntry(t, bundle, tamperedResources, "resources.json")
+
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		res, err := testExecute(e, fmt.Sprintf("apps import -a app1 -f %s --verify %s", tamperedResources, pubfile), nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, res.Code)
+		res.RequireStderr(t, []string{"ERROR: signature verification failed: signature does not match bundle contents"})
+	})
+
+	// missing signature
+	nosig := filepath.Join(tmp, "app.nosig.tgz")
+	exportSignedBundle(t, nosig, "")
+
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		res, err := testExecute(e, fmt.Sprintf("apps import -a app1 -f %s --verify %s", nosig, pubfile), nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, res.Code)
+		res.RequireStderr(t, []string{"ERROR: signature verification failed: no signature present"})
+	})
+}
+
+func TestAppsExportSignAndImportVerifyCertChain(t *testing.T) {
+	for _, leafAlgo := range []string{"ecdsa", "ed25519"} {
+		t.Run(leafAlgo, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "")
+			require.NoError(t, err)
+			defer os.RemoveAll(tmp)
+
+			keyfile, capemfile := generateCertChainKeyfile(t, tmp, leafAlgo)
+
+			bundle := filepath.Join(tmp, "app.tgz")
+			exportSignedBundle(t, bundle, keyfile)
+
+			// valid signature
+			testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+				stubImport(i)
+
+				res, err := testExecute(e, fmt.Sprintf("apps import -a app1 -f %s --verify %s", bundle, capemfile), nil)
+				require.NoError(t, err)
+				require.Equal(t, 0, res.Code)
+			})
+
+			// tampered build.tgz
+			tampered := filepath.Join(tmp, "app.tampered.tgz")
+			corruptBundleEntry(t, bundle, tampered, "build.tgz")
+
+			testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+				res, err := testExecute(e, fmt.Sprintf("apps import -a app1 -f %s --verify %s", tampered, capemfile), nil)
+				require.NoError(t, err)
+				require.Equal(t, 1, res.Code)
+				res.RequireStderr(t, []string{"ERROR: signature verification failed: signature does not match bundle contents"})
+			})
+		})
+	}
+}
+
+// generateCertChainKeyfile creates a self-signed CA and a leaf certificate
+// issued by it (with a code-signing-only EKU, to exercise the
+// x509.ExtKeyUsageAny override in verifyBundleCert), writes a --sign keyfile
+// containing the leaf's PKCS8 private key plus its certificate, and returns
+// it alongside a --verify CA bundle containing just the root.
+func generateCertChainKeyfile(t *testing.T, dir, leafAlgo string) (string, string) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	var leafPub crypto.PublicKey
+	var leafPriv crypto.Signer
+
+	if leafAlgo == "ed25519" {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		leafPub, leafPriv = pub, priv
+	} else {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		leafPub, leafPriv = &priv.PublicKey, priv
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, leafPub, caKey)
+	require.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(leafPriv)
+	require.NoError(t, err)
+
+	var keyPEM bytes.Buffer
+	require.NoError(t, pem.Encode(&keyPEM, &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	require.NoError(t, pem.Encode(&keyPEM, &pem.Block{Type: "CERTIFICATE", Bytes: leafDER}))
+
+	keyfile := filepath.Join(dir, fmt.Sprintf("%s.key", leafAlgo))
+	require.NoError(t, ioutil.WriteFile(keyfile, keyPEM.Bytes(), 0600))
+
+	var caPEM bytes.Buffer
+	require.NoError(t, pem.Encode(&caPEM, &pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+
+	capemfile := filepath.Join(dir, fmt.Sprintf("%s.ca.pem", leafAlgo))
+	require.NoError(t, ioutil.WriteFile(capemfile, caPEM.Bytes(), 0644))
+
+	return keyfile, capemfile
+}
+
+// exportSignedBundle runs `apps export`, optionally with --sign, against a
+// fresh mock client and writes the resulting tarball to dest.
+func exportSignedBundle(t *testing.T, dest, keyfile string) {
+	testClient(t, func(e *cli.Engine, i *mocksdk.Interface) {
+		i.On("AppGet", "app1").Return(fxApp(), nil)
+		i.On("ReleaseGet", "app1", "release1").Return(fxRelease(), nil)
+		bdata, err := ioutil.ReadFile("testdata/build.tgz")
+		require.NoError(t, err)
+		i.On("BuildExport", "app1", "build1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			args.Get(2).(io.Writer).Write(bdata)
+		})
+		i.On("ResourceList", "app1").Return(structs.Resources{*fxResource()}, nil)
+		rdata, err := ioutil.ReadFile("testdata/resource.export")
+		require.NoError(t, err)
+		i.On("ResourceExport", "app1", "resource1").Return(ioutil.NopCloser(bytes.NewReader(rdata)), nil)
+
+		cmd := fmt.Sprintf("apps export -a app1 -f %s", dest)
+		if keyfile != "" {
+			cmd += fmt.Sprintf(" --sign %s", keyfile)
+		}
+
+		res, err := testExecute(e, cmd, nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Code)
+	})
+}
+
+func stubImport(i *mocksdk.Interface) {
+	i.On("AppCreate", "app1", mock.Anything).Return(fxApp(), nil)
+	i.On("AppGet", "app1").Return(fxApp(), nil)
+	i.On("BuildImport", "app1", mock.Anything).Return(fxBuild(), nil)
+	i.On("ReleaseCreate", "app1", mock.Anything).Return(fxRelease(), nil)
+	i.On("ReleasePromote", "app1", "release1", mock.Anything).Return(nil)
+	i.On("ResourceList", "app1").Return(structs.Resources{*fxResource()}, nil)
+	i.On("ResourceImport", "app1", "resource1", mock.Anything).Return(nil)
+}
+
+// corruptBundleEntry unpacks src, flips a byte in the named entry, and
+// repacks the result as dst, so tests can exercise signature verification
+// against a tampered bundle without hand-authoring one.
+func corruptBundleEntry(t *testing.T, src, dst, name string) {
+	tmp, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	fd, err := os.Open(src)
+	require.NoError(t, err)
+	defer fd.Close()
+
+	gz, err := gzip.NewReader(fd)
+	require.NoError(t, err)
+	require.NoError(t, common.Unarchive(gz, tmp))
+
+	target := filepath.Join(tmp, name)
+
+	data, err := ioutil.ReadFile(target)
+	require.NoError(t, err)
+
+	if len(data) == 0 {
+		data = []byte{0}
+	}
+	data[0] ^= 0xff
+
+	require.NoError(t, ioutil.WriteFile(target, data, 0644))
+
+	out, err := os.Create(dst)
+	require.NoError(t, err)
+	defer out.Close()
+
+	gzw := gzip.NewWriter(out)
+	defer gzw.Close()
+
+	require.NoError(t, common.Archive(gzw, tmp))
+}
@@ -0,0 +1,75 @@
+// Package output renders command results in the table, JSON, or YAML
+// format requested via `--output/-o`. Commands that adopt it implement
+// their table rendering once as today, then hand a structured value (a
+// struct, slice, or map) to Render for the json/yaml cases instead of
+// duplicating a formatter per command.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Format names accepted by --output/-o.
+const (
+	Table = "table"
+	JSON  = "json"
+	YAML  = "yaml"
+)
+
+// Renderer writes a structured value to w in its format.
+type Renderer interface {
+	Render(w io.Writer, v interface{}) error
+}
+
+// New returns the Renderer for format. An empty format is equivalent to
+// Table.
+func New(format string) (Renderer, error) {
+	switch format {
+	case "", Table:
+		return tableRenderer{}, nil
+	case JSON:
+		return jsonRenderer{}, nil
+	case YAML:
+		return yamlRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// tableRenderer does not render: its Render always returns an error.
+// Commands that support structured output keep
+// rendering their own tables for the default format, since that rendering
+// already exists and varies per command (column choice, width, sorting).
+type tableRenderer struct{}
+
+func (tableRenderer) Render(w io.Writer, v interface{}) error {
+	return fmt.Errorf("table output is rendered by the command, not output.Renderer")
+}
+
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+type yamlRenderer struct{}
+
+func (yamlRenderer) Render(w io.Writer, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
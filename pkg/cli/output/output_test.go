@@ -0,0 +1,47 @@
+package output_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/convox/convox/pkg/cli/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	type fixture struct {
+		Name string `json:"name" yaml:"name"`
+	}
+
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{output.JSON, `{"name":"app1"}`},
+		{output.YAML, "name: app1\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.format, func(t *testing.T) {
+			r, err := output.New(tc.format)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, r.Render(&buf, fixture{Name: "app1"}))
+			require.Equal(t, tc.want, buf.String())
+		})
+	}
+}
+
+func TestRenderTable(t *testing.T) {
+	r, err := output.New(output.Table)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.Error(t, r.Render(&buf, struct{}{}))
+}
+
+func TestNewUnknownFormat(t *testing.T) {
+	_, err := output.New("xml")
+	require.Error(t, err)
+}
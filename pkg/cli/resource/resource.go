@@ -0,0 +1,85 @@
+// Package resource lets `apps export`/`apps import` treat each resource
+// type's data as an opaque, content-typed blob instead of streaming raw
+// bytes to and from the rack API with no notion of what they contain.
+// Every resource type registers a Driver declaring the content type it
+// produces, so an export can tag what it wrote and an import can refuse
+// to load, say, a postgres dump into a mysql resource.
+package resource
+
+import (
+	"io"
+	"sync"
+)
+
+// Driver exports and imports the data for one resource type.
+type Driver interface {
+	// ContentType identifies the wire format this driver produces, e.g.
+	// "application/x-postgres-dump".
+	ContentType() string
+
+	// Export copies a resource's data from src, as returned by the rack
+	// API, to dst for staging into the export bundle.
+	Export(dst io.Writer, src io.Reader) error
+
+	// Import copies a resource's staged bundle data from src to dst in
+	// preparation for handing it to the rack API.
+	Import(dst io.Writer, src io.Reader) error
+}
+
+var (
+	mu      sync.RWMutex
+	drivers = map[string]Driver{}
+)
+
+// Register adds a Driver for the given resource type, overwriting any
+// driver previously registered for it. Third parties vendoring the CLI
+// can call this from an init() to add support for additional resource
+// types.
+func Register(typeName string, driver Driver) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	drivers[typeName] = driver
+}
+
+// Lookup returns the Driver registered for typeName, or a generic
+// octet-stream driver if none is registered.
+func Lookup(typeName string) Driver {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if d, ok := drivers[typeName]; ok {
+		return d
+	}
+
+	return copyDriver{contentType: "application/octet-stream"}
+}
+
+// copyDriver is a Driver that declares a content type but otherwise
+// passes data straight through. It backs every built-in driver today
+// since the CLI has no local access to a resource's native protocol and
+// relies on the rack API to have already produced the right format; it
+// gives third parties a registration point to layer real transcoding on
+// top of later without changing the export/import plumbing.
+type copyDriver struct {
+	contentType string
+}
+
+func (d copyDriver) ContentType() string { return d.contentType }
+
+func (d copyDriver) Export(dst io.Writer, src io.Reader) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+func (d copyDriver) Import(dst io.Writer, src io.Reader) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+func init() {
+	Register("postgres", copyDriver{contentType: "application/x-postgres-dump"})
+	Register("mysql", copyDriver{contentType: "application/x-mysqldump"})
+	Register("redis", copyDriver{contentType: "application/vnd.convox.redis-rdb"})
+	Register("s3", copyDriver{contentType: "application/x-tar"})
+}
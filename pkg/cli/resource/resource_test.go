@@ -0,0 +1,55 @@
+package resource_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/convox/convox/pkg/cli/resource"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupBuiltin(t *testing.T) {
+	cases := map[string]string{
+		"postgres": "application/x-postgres-dump",
+		"mysql":    "application/x-mysqldump",
+		"redis":    "application/vnd.convox.redis-rdb",
+		"s3":       "application/x-tar",
+	}
+
+	for typeName, contentType := range cases {
+		require.Equal(t, contentType, resource.Lookup(typeName).ContentType())
+	}
+}
+
+func TestLookupUnknown(t *testing.T) {
+	require.Equal(t, "application/octet-stream", resource.Lookup("nope").ContentType())
+}
+
+func TestRegister(t *testing.T) {
+	resource.Register("mongo", testDriver{contentType: "application/x-mongodump"})
+
+	require.Equal(t, "application/x-mongodump", resource.Lookup("mongo").ContentType())
+}
+
+func TestDriverExportImport(t *testing.T) {
+	d := resource.Lookup("postgres")
+
+	var buf bytes.Buffer
+	require.NoError(t, d.Export(&buf, bytes.NewReader([]byte("dump"))))
+	require.Equal(t, "dump", buf.String())
+
+	var out bytes.Buffer
+	require.NoError(t, d.Import(&out, bytes.NewReader(buf.Bytes())))
+	require.Equal(t, "dump", out.String())
+}
+
+type testDriver struct {
+	contentType string
+}
+
+func (d testDriver) ContentType() string { return d.contentType }
+
+func (d testDriver) Export(dst io.Writer, src io.Reader) error { return nil }
+
+func (d testDriver) Import(dst io.Writer, src io.Reader) error { return nil }
@@ -0,0 +1,86 @@
+// Package structs defines the data types shared between the Convox SDK,
+// the CLI and the rack API.
+package structs
+
+import "io"
+
+// App represents a Convox application.
+type App struct {
+	Generation string            `json:"generation" yaml:"generation"`
+	Locked     bool              `json:"locked" yaml:"locked"`
+	Name       string            `json:"name" yaml:"name"`
+	Release    string            `json:"release" yaml:"release"`
+	Router     string            `json:"router" yaml:"router"`
+	Status     string            `json:"status" yaml:"status"`
+	Parameters map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+// Apps is a collection of App.
+type Apps []App
+
+// AppCreateOptions are the options for AppCreate.
+type AppCreateOptions struct {
+	Generation *string
+}
+
+// AppUpdateOptions are the options for AppUpdate.
+type AppUpdateOptions struct {
+	Parameters map[string]string
+}
+
+// Build represents an app build.
+type Build struct {
+	Id      string
+	App     string
+	Release string
+	Status  string
+	Started string
+	Ended   string
+}
+
+// Builds is a collection of Build.
+type Builds []Build
+
+// Release represents an app release.
+type Release struct {
+	Id      string
+	App     string
+	Build   string
+	Env     string
+	Created string
+}
+
+// Releases is a collection of Release.
+type Releases []Release
+
+// ReleaseCreateOptions are the options for ReleaseCreate.
+type ReleaseCreateOptions struct {
+	Build *string
+	Env   *string
+}
+
+// ReleasePromoteOptions are the options for ReleasePromote.
+type ReleasePromoteOptions struct {
+	Force *bool
+}
+
+// Resource represents a resource attached to an app.
+type Resource struct {
+	Name   string
+	Type   string
+	Status string
+	Url    string
+}
+
+// Resources is a collection of Resource.
+type Resources []Resource
+
+// System represents the rack itself.
+type System struct {
+	Name     string
+	Version  string
+	Provider string
+}
+
+// Stream is a convenience alias used by commands that read log-like data.
+type Stream io.Reader